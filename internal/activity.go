@@ -27,9 +27,9 @@ package internal
 import (
 	"context"
 	"fmt"
+	"math"
 	"time"
 
-	"github.com/opentracing/opentracing-go"
 	"github.com/uber-go/tally"
 	commonpb "go.temporal.io/api/common/v1"
 	"go.temporal.io/api/workflowservice/v1"
@@ -57,8 +57,16 @@ type (
 		HeartbeatTimeout  time.Duration // Maximum time between heartbeats. 0 means no heartbeat needed.
 		ScheduledTime     time.Time     // Time of activity scheduled by a workflow
 		StartedTime       time.Time     // Time of activity start
-		Deadline          time.Time     // Time of activity timeout
+		Deadline          time.Time     // Time of activity timeout for this attempt
 		Attempt           int32         // Attempt starts from 1, and increased by 1 for every retry if retry policy is specified.
+
+		// ScheduleToCloseDeadline is the point in time, fixed at the activity's original scheduling and held
+		// constant across retries, after which ScheduleToCloseTimeout is exceeded. It is the zero time.Time if
+		// ScheduleToCloseTimeout wasn't set. Unlike Deadline, which is clamped per attempt and can in principle
+		// be nudged later by clock skew between attempts, ScheduleToCloseDeadline never moves, so activity code
+		// that wants to bail out early rather than being killed mid-write can check it directly, or use
+		// activity.RemainingBudget(ctx).
+		ScheduleToCloseDeadline time.Time
 	}
 
 	// RegisterActivityOptions consists of options for registering an activity
@@ -72,6 +80,15 @@ type (
 		// When registering a struct with activities, skip functions that are not valid activities. If false,
 		// registration panics.
 		SkipInvalidStructFunctions bool
+
+		// EnableAutoHeartbeat, if set, causes the worker to automatically record a heartbeat on behalf of
+		// this activity at an interval safely below its negotiated HeartbeatTimeout, so long-running
+		// activities aren't timed out just because they forgot to call RecordActivityHeartbeat. A manual
+		// RecordActivityHeartbeat call still takes precedence: it is handed to the service invoker as usual
+		// (subject to HeartbeatThrottleInterval batching), restarts the automatic interval, and its details are
+		// what the next automatic heartbeat reports. Has no effect on activities with no HeartbeatTimeout,
+		// and is always a no-op for local activities.
+		EnableAutoHeartbeat bool
 	}
 
 	// ActivityOptions stores all activity-specific parameters that will be stored inside of a context.
@@ -111,6 +128,15 @@ type (
 		// before this interval passes after the last heartbeat or the Activity starts.
 		HeartbeatTimeout time.Duration
 
+		// HeartbeatThrottleInterval - Minimum interval between heartbeats actually sent to the server; heartbeats
+		// requested more often than this are batched and the latest one flushed once the interval elapses, to
+		// avoid overwhelming the server from activities that heartbeat in a tight loop. Use
+		// activity.RecordHeartbeatNow to bypass this for a single call, e.g. to checkpoint right before a long
+		// blocking operation.
+		// Optional: defaults to WorkerOptions.DefaultHeartbeatThrottleInterval, clamped to
+		// WorkerOptions.MaxHeartbeatThrottleInterval.
+		HeartbeatThrottleInterval time.Duration
+
 		// WaitForCancellation - Whether to wait for canceled activity to be completed(
 		// activity can be failed, completed, cancel accepted)
 		// Optional: default false
@@ -152,27 +178,48 @@ type (
 
 // GetActivityInfo returns information about currently executing activity.
 func GetActivityInfo(ctx context.Context) ActivityInfo {
+	return activityOutboundInterceptorFromContext(ctx).GetInfo(ctx)
+}
+
+// getInfoFromActivityEnv is the root implementation of GetActivityInfo, called through the outbound interceptor
+// chain by rootActivityOutboundInterceptor.
+func getInfoFromActivityEnv(ctx context.Context) ActivityInfo {
 	env := getActivityEnv(ctx)
 	return ActivityInfo{
-		ActivityID:        env.activityID,
-		ActivityType:      env.activityType,
-		TaskToken:         env.taskToken,
-		WorkflowExecution: env.workflowExecution,
-		HeartbeatTimeout:  env.heartbeatTimeout,
-		Deadline:          env.deadline,
-		ScheduledTime:     env.scheduledTime,
-		StartedTime:       env.startedTime,
-		TaskQueue:         env.taskQueue,
-		Attempt:           env.attempt,
-		WorkflowType:      env.workflowType,
-		WorkflowNamespace: env.workflowNamespace,
+		ActivityID:              env.activityID,
+		ActivityType:            env.activityType,
+		TaskToken:               env.taskToken,
+		WorkflowExecution:       env.workflowExecution,
+		HeartbeatTimeout:        env.heartbeatTimeout,
+		Deadline:                env.deadline,
+		ScheduledTime:           env.scheduledTime,
+		StartedTime:             env.startedTime,
+		TaskQueue:               env.taskQueue,
+		Attempt:                 env.attempt,
+		WorkflowType:            env.workflowType,
+		WorkflowNamespace:       env.workflowNamespace,
+		ScheduleToCloseDeadline: env.scheduleToCloseDeadline,
+	}
+}
+
+// RemainingBudget returns how much of ScheduleToCloseTimeout remains for the currently executing activity, measured
+// from the original scheduling time rather than from the start of this attempt. It returns 0 once that budget is
+// exhausted, and the maximum time.Duration if no ScheduleToCloseTimeout was set. Long-running activities that want
+// to bail out early rather than being killed mid-write can poll this instead of waiting for ctx to be canceled.
+func RemainingBudget(ctx context.Context) time.Duration {
+	env := getActivityEnv(ctx)
+	if env.scheduleToCloseDeadline.IsZero() {
+		return math.MaxInt64
 	}
+	if remaining := time.Until(env.scheduleToCloseDeadline); remaining > 0 {
+		return remaining
+	}
+	return 0
 }
 
 // HasHeartbeatDetails checks if there is heartbeat details from last attempt.
 func HasHeartbeatDetails(ctx context.Context) bool {
-	env := getActivityEnv(ctx)
-	return env.heartbeatDetails != nil
+	return activityOutboundInterceptorFromContext(ctx).HasHeartbeatDetails(ctx)
 }
 
 // GetHeartbeatDetails extract heartbeat details from last failed attempt. This is used in combination with retry policy.
@@ -191,14 +238,12 @@ func GetHeartbeatDetails(ctx context.Context, d ...interface{}) error {
 
 // GetActivityLogger returns a logger that can be used in activity
 func GetActivityLogger(ctx context.Context) log.Logger {
-	env := getActivityEnv(ctx)
-	return env.logger
+	return activityOutboundInterceptorFromContext(ctx).GetLogger(ctx)
 }
 
 // GetActivityMetricsScope returns a metrics scope that can be used in activity
 func GetActivityMetricsScope(ctx context.Context) tally.Scope {
-	env := getActivityEnv(ctx)
-	return env.metricsScope
+	return activityOutboundInterceptorFromContext(ctx).GetMetricsScope(ctx)
 }
 
 // GetWorkerStopChannel returns a read-only channel. The closure of this channel indicates the activity worker is stopping.
@@ -213,12 +258,34 @@ func GetWorkerStopChannel(ctx context.Context) <-chan struct{} {
 // RecordActivityHeartbeat sends heartbeat for the currently executing activity
 // If the activity is either canceled (or) workflow/activity doesn't exist then we would cancel
 // the context with error context.Canceled.
-//  TODO: we don't have a way to distinguish between the two cases when context is canceled because
-//  context doesn't support overriding value of ctx.Error.
-//  TODO: Implement automatic heartbeating with cancellation through ctx.
+//
+//	TODO: we don't have a way to distinguish between the two cases when context is canceled because
+//	context doesn't support overriding value of ctx.Error.
+//
 // details - the details that you provided here can be seen in the worflow when it receives TimeoutError, you
 // can check error TimeoutType()/Details().
 func RecordActivityHeartbeat(ctx context.Context, details ...interface{}) {
+	activityOutboundInterceptorFromContext(ctx).RecordHeartbeat(ctx, details...)
+}
+
+// RecordHeartbeatNow immediately sends the heartbeat for the currently executing activity, bypassing the
+// HeartbeatThrottleInterval batching window that RecordActivityHeartbeat would otherwise hold it in. Useful for
+// checkpointing progress right before a long blocking call that won't get another chance to heartbeat for a while.
+// Like RecordActivityHeartbeat, it is a no-op for local activities.
+func RecordHeartbeatNow(ctx context.Context, details ...interface{}) {
+	activityOutboundInterceptorFromContext(ctx).RecordHeartbeatNow(ctx, details...)
+}
+
+// recordActivityHeartbeat is the root implementation of RecordActivityHeartbeat, called through the outbound
+// interceptor chain by rootActivityOutboundInterceptor.
+func recordActivityHeartbeat(ctx context.Context, details ...interface{}) {
+	recordActivityHeartbeatImpl(ctx, false, details...)
+}
+
+// recordActivityHeartbeatImpl does the actual work for recordActivityHeartbeat and RecordHeartbeatNow. skipBatching
+// forces an immediate flush to the server rather than letting it sit in the HeartbeatThrottleInterval batching
+// window, as the service invoker's Heartbeat normally would.
+func recordActivityHeartbeatImpl(ctx context.Context, skipBatching bool, details ...interface{}) {
 	env := getActivityEnv(ctx)
 	if env.isLocalActivity {
 		// no-op for local activity
@@ -234,11 +301,30 @@ func RecordActivityHeartbeat(ctx context.Context, details ...interface{}) {
 		}
 	}
 
-	err = env.serviceInvoker.Heartbeat(ctx, data, false)
+	err = env.serviceInvoker.Heartbeat(ctx, data, skipBatching)
 	if err != nil {
 		log := GetActivityLogger(ctx)
 		log.Debug("RecordActivityHeartbeat with error", tagError, err)
 	}
+
+	if h, ok := ctx.Value(autoHeartbeatContextKey).(*autoHeartbeater); ok {
+		h.recordAndReset(data)
+	}
+}
+
+// EffectiveHeartbeatThrottleInterval resolves ActivityOptions.HeartbeatThrottleInterval against the worker's
+// configured WorkerOptions.Default/MaxHeartbeatThrottleInterval: scheduled falls back to def if unset (zero), and
+// the result is clamped to maxInterval if maxInterval is positive. Callers building the context for an activity
+// task (via WithActivityTask) use this to compute the heartbeatThrottleInterval argument.
+func EffectiveHeartbeatThrottleInterval(scheduled, def, maxInterval time.Duration) time.Duration {
+	interval := scheduled
+	if interval <= 0 {
+		interval = def
+	}
+	if maxInterval > 0 && interval > maxInterval {
+		interval = maxInterval
+	}
+	return interval
 }
 
 // ServiceInvoker abstracts calls to the Temporal service from an activity implementation.
@@ -250,6 +336,15 @@ type ServiceInvoker interface {
 	GetClient(options ClientOptions) Client
 }
 
+// HeartbeatThrottleIntervalSetter is optionally implemented by a ServiceInvoker that batches heartbeats (i.e.
+// Heartbeat calls with skipBatching false) on a timer rather than sending every one immediately.
+// WithActivityTask calls SetHeartbeatThrottleInterval once per activity task, before the activity function runs,
+// with the effective interval resolved from ActivityOptions.HeartbeatThrottleInterval and
+// WorkerOptions.Default/MaxHeartbeatThrottleInterval via EffectiveHeartbeatThrottleInterval.
+type HeartbeatThrottleIntervalSetter interface {
+	SetHeartbeatThrottleInterval(d time.Duration)
+}
+
 // WithActivityTask adds activity specific information into context.
 // Use this method to unit test activity implementations that use context extractor methodshared.
 func WithActivityTask(
@@ -262,9 +357,15 @@ func WithActivityTask(
 	dataConverter converter.DataConverter,
 	workerStopChannel <-chan struct{},
 	contextPropagators []ContextPropagator,
-	tracer opentracing.Tracer,
+	tracer Tracer,
+	enableAutoHeartbeat bool,
+	heartbeatThrottleInterval time.Duration,
 ) context.Context {
 	var deadline time.Time
+	var scheduleToCloseDeadline time.Time
+	// scheduled is when the activity was originally scheduled, not when this particular attempt was dispatched,
+	// so it stays fixed across retries; combined with ScheduleToCloseTimeout this gives an attempt-independent
+	// deadline that the server's per-attempt expiration can't accidentally extend past.
 	scheduled := common.TimeValue(task.GetScheduledTime())
 	started := common.TimeValue(task.GetStartedTime())
 	scheduleToCloseTimeout := common.DurationValue(task.GetScheduleToCloseTimeout())
@@ -273,8 +374,9 @@ func WithActivityTask(
 
 	startToCloseDeadline := started.Add(startToCloseTimeout)
 	if scheduleToCloseTimeout > 0 {
-		scheduleToCloseDeadline := scheduled.Add(scheduleToCloseTimeout)
-		// Minimum of the two deadlines.
+		scheduleToCloseDeadline = scheduled.Add(scheduleToCloseTimeout)
+		// Minimum of the two deadlines, enforced strictly client-side so that clock skew or a server that
+		// extends an individual attempt's expiration can't let the total elapsed time exceed ScheduleToCloseTimeout.
 		if scheduleToCloseDeadline.Before(startToCloseDeadline) {
 			deadline = scheduleToCloseDeadline
 		} else {
@@ -293,7 +395,7 @@ func WithActivityTask(
 		tagRunID, task.WorkflowExecution.RunId,
 	)
 
-	return context.WithValue(ctx, activityEnvContextKey, &activityEnvironment{
+	ctx = context.WithValue(ctx, activityEnvContextKey, &activityEnvironment{
 		taskToken:      task.TaskToken,
 		serviceInvoker: invoker,
 		activityType:   ActivityType{Name: task.ActivityType.GetName()},
@@ -301,28 +403,45 @@ func WithActivityTask(
 		workflowExecution: WorkflowExecution{
 			RunID: task.WorkflowExecution.RunId,
 			ID:    task.WorkflowExecution.WorkflowId},
-		logger:           logger,
-		metricsScope:     scope,
-		deadline:         deadline,
-		heartbeatTimeout: heartbeatTimeout,
-		scheduledTime:    scheduled,
-		startedTime:      started,
-		taskQueue:        taskQueue,
-		dataConverter:    dataConverter,
-		attempt:          task.GetAttempt(),
-		heartbeatDetails: task.HeartbeatDetails,
+		logger:                  logger,
+		metricsScope:            scope,
+		deadline:                deadline,
+		scheduleToCloseDeadline: scheduleToCloseDeadline,
+		heartbeatTimeout:        heartbeatTimeout,
+		scheduledTime:           scheduled,
+		startedTime:             started,
+		taskQueue:               taskQueue,
+		dataConverter:           dataConverter,
+		attempt:                 task.GetAttempt(),
+		heartbeatDetails:        task.HeartbeatDetails,
 		workflowType: &WorkflowType{
 			Name: task.WorkflowType.GetName(),
 		},
-		workflowNamespace:  task.WorkflowNamespace,
-		workerStopChannel:  workerStopChannel,
-		contextPropagators: contextPropagators,
-		tracer:             tracer,
+		workflowNamespace:   task.WorkflowNamespace,
+		workerStopChannel:   workerStopChannel,
+		contextPropagators:  contextPropagators,
+		tracer:              tracer,
+		header:              task.GetHeader(),
+		enableAutoHeartbeat: enableAutoHeartbeat,
 	})
+
+	if setter, ok := invoker.(HeartbeatThrottleIntervalSetter); ok {
+		setter.SetHeartbeatThrottleInterval(heartbeatThrottleInterval)
+	}
+
+	// The real per-activity interceptor chain (ActivityInterceptorFactory, WorkerOptions.ActivityInterceptors) is
+	// resolved and installed by ExecuteActivityWithInterceptors once the activity is actually about to run;
+	// until then, direct calls to GetActivityInfo/RecordActivityHeartbeat/etc. fall back to this root interceptor.
+	ctx = WithActivityOutboundInterceptor(ctx, rootActivityOutboundInterceptor{})
+
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithCancel(ctx)
+	ctx, stop := WithAutoHeartbeat(ctx, cancel)
+	return context.WithValue(ctx, autoHeartbeatStopContextKey, stop)
 }
 
 // WithLocalActivityTask adds local activity specific information into context.
-func WithLocalActivityTask(ctx context.Context, task *localActivityTask, logger log.Logger, scope tally.Scope, dataConverter converter.DataConverter) context.Context {
+func WithLocalActivityTask(ctx context.Context, task *localActivityTask, logger log.Logger, scope tally.Scope, dataConverter converter.DataConverter, enableAutoHeartbeat bool) context.Context {
 	if ctx == nil {
 		ctx = context.Background()
 	}
@@ -338,17 +457,28 @@ func WithLocalActivityTask(ctx context.Context, task *localActivityTask, logger
 		tagRunID, task.params.WorkflowInfo.WorkflowExecution.RunID,
 	)
 	ctx = context.WithValue(ctx, activityEnvContextKey, &activityEnvironment{
-		workflowType:      &workflowTypeLocal,
-		workflowNamespace: task.params.WorkflowInfo.Namespace,
-		taskQueue:         task.params.WorkflowInfo.TaskQueueName,
-		activityType:      ActivityType{Name: activityType},
-		activityID:        fmt.Sprintf("%v", task.activityID),
-		workflowExecution: task.params.WorkflowInfo.WorkflowExecution,
-		logger:            logger,
-		metricsScope:      scope,
-		isLocalActivity:   true,
-		dataConverter:     dataConverter,
-		attempt:           task.attempt,
+		workflowType:        &workflowTypeLocal,
+		workflowNamespace:   task.params.WorkflowInfo.Namespace,
+		taskQueue:           task.params.WorkflowInfo.TaskQueueName,
+		activityType:        ActivityType{Name: activityType},
+		activityID:          fmt.Sprintf("%v", task.activityID),
+		workflowExecution:   task.params.WorkflowInfo.WorkflowExecution,
+		logger:              logger,
+		metricsScope:        scope,
+		isLocalActivity:     true,
+		dataConverter:       dataConverter,
+		attempt:             task.attempt,
+		enableAutoHeartbeat: enableAutoHeartbeat,
 	})
-	return ctx
+
+	// See the comment in WithActivityTask: the real interceptor chain is installed by
+	// ExecuteActivityWithInterceptors, so this is just the fallback root.
+	ctx = WithActivityOutboundInterceptor(ctx, rootActivityOutboundInterceptor{})
+
+	// WithAutoHeartbeat always no-ops here since env.isLocalActivity is set above, but calling it keeps the
+	// wiring identical to WithActivityTask and correct should local activities ever gain heartbeat support.
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithCancel(ctx)
+	ctx, stop := WithAutoHeartbeat(ctx, cancel)
+	return context.WithValue(ctx, autoHeartbeatStopContextKey, stop)
 }
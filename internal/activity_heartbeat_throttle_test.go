@@ -0,0 +1,136 @@
+// The MIT License
+//
+// Copyright (c) 2020 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package internal
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	commonpb "go.temporal.io/api/common/v1"
+	"go.temporal.io/api/workflowservice/v1"
+
+	"go.temporal.io/sdk/log"
+)
+
+func TestEffectiveHeartbeatThrottleInterval(t *testing.T) {
+	cases := []struct {
+		name                string
+		scheduled, def, max time.Duration
+		want                time.Duration
+	}{
+		{"unset falls back to default", 0, 30 * time.Second, 60 * time.Second, 30 * time.Second},
+		{"explicit value under max is kept", 10 * time.Second, 30 * time.Second, 60 * time.Second, 10 * time.Second},
+		{"explicit value over max is clamped", 90 * time.Second, 30 * time.Second, 60 * time.Second, 60 * time.Second},
+		{"default over max is clamped", 0, 90 * time.Second, 60 * time.Second, 60 * time.Second},
+		{"no max means no clamp", 90 * time.Second, 30 * time.Second, 0, 90 * time.Second},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			require.Equal(t, c.want, EffectiveHeartbeatThrottleInterval(c.scheduled, c.def, c.max))
+		})
+	}
+}
+
+// throttleSettingServiceInvoker records whatever throttle interval WithActivityTask passes on to it, in addition
+// to the heartbeats it receives, so the throttle interval wiring can be tested end to end.
+type throttleSettingServiceInvoker struct {
+	mu               sync.Mutex
+	throttleInterval time.Duration
+	heartbeats       []bool // one entry per Heartbeat call, its skipBatching argument
+}
+
+func (t *throttleSettingServiceInvoker) SetHeartbeatThrottleInterval(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.throttleInterval = d
+}
+
+func (t *throttleSettingServiceInvoker) Heartbeat(ctx context.Context, details *commonpb.Payloads, skipBatching bool) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.heartbeats = append(t.heartbeats, skipBatching)
+	return nil
+}
+
+func (t *throttleSettingServiceInvoker) Close(ctx context.Context, flushBufferedHeartbeat bool) {}
+
+func (t *throttleSettingServiceInvoker) GetClient(options ClientOptions) Client { return nil }
+
+var _ HeartbeatThrottleIntervalSetter = (*throttleSettingServiceInvoker)(nil)
+
+func TestWithActivityTask_SetsHeartbeatThrottleIntervalOnInvoker(t *testing.T) {
+	invoker := &throttleSettingServiceInvoker{}
+	task := &workflowservice.PollActivityTaskQueueResponse{
+		WorkflowExecution: &commonpb.WorkflowExecution{WorkflowId: "wf", RunId: "run"},
+	}
+
+	effective := EffectiveHeartbeatThrottleInterval(0, 30*time.Second, 60*time.Second)
+	ctx := WithActivityTask(context.Background(), task, "tq", invoker, log.NewDefaultLogger(), nil, nil, nil, nil, nil, false, effective)
+	defer GetAutoHeartbeatStopFunc(ctx)()
+
+	invoker.mu.Lock()
+	defer invoker.mu.Unlock()
+	require.Equal(t, 30*time.Second, invoker.throttleInterval)
+}
+
+func TestRecordHeartbeatNow_RoutesThroughOutboundInterceptor(t *testing.T) {
+	invoker := &throttleSettingServiceInvoker{}
+	ctx := context.WithValue(context.Background(), activityEnvContextKey, &activityEnvironment{serviceInvoker: invoker})
+	ctx = WithActivityOutboundInterceptor(ctx, rootActivityOutboundInterceptor{})
+
+	RecordHeartbeatNow(ctx, "detail")
+
+	invoker.mu.Lock()
+	defer invoker.mu.Unlock()
+	require.Equal(t, []bool{true}, invoker.heartbeats, "RecordHeartbeatNow must bypass batching (skipBatching=true)")
+}
+
+func TestRecordHeartbeatNow_SeenByActivityOutboundInterceptor(t *testing.T) {
+	invoker := &throttleSettingServiceInvoker{}
+	ctx := context.WithValue(context.Background(), activityEnvContextKey, &activityEnvironment{serviceInvoker: invoker})
+
+	var sawRecordHeartbeatNow bool
+	outbound := &ActivityOutboundInterceptorBase{Next: rootActivityOutboundInterceptor{}}
+	wrapped := &recordingOutboundInterceptor{ActivityOutboundInterceptorBase: *outbound, onRecordHeartbeatNow: func() { sawRecordHeartbeatNow = true }}
+	ctx = WithActivityOutboundInterceptor(ctx, wrapped)
+
+	RecordHeartbeatNow(ctx, "detail")
+
+	require.True(t, sawRecordHeartbeatNow, "an interceptor wrapping RecordHeartbeatNow must see RecordHeartbeatNow calls, matching how RecordActivityHeartbeat is routed")
+}
+
+type recordingOutboundInterceptor struct {
+	ActivityOutboundInterceptorBase
+	onRecordHeartbeatNow func()
+}
+
+func (i *recordingOutboundInterceptor) RecordHeartbeatNow(ctx context.Context, details ...interface{}) {
+	i.onRecordHeartbeatNow()
+	i.ActivityOutboundInterceptorBase.RecordHeartbeatNow(ctx, details...)
+}
@@ -0,0 +1,114 @@
+// The MIT License
+//
+// Copyright (c) 2020 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package internal
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	commonpb "go.temporal.io/api/common/v1"
+	"go.temporal.io/api/workflowservice/v1"
+
+	"go.temporal.io/sdk/log"
+)
+
+func TestRemainingBudget_NoScheduleToCloseTimeout(t *testing.T) {
+	ctx := context.WithValue(context.Background(), activityEnvContextKey, &activityEnvironment{})
+	require.Equal(t, time.Duration(math.MaxInt64), RemainingBudget(ctx))
+}
+
+func TestRemainingBudget_ExhaustedAcrossRetries(t *testing.T) {
+	// scheduleToCloseDeadline is fixed at original scheduling time, independent of this attempt's deadline, so a
+	// retry attempt that starts after the overall budget expired must see 0 even though its own Deadline may be
+	// later (e.g. due to clock skew between attempts).
+	ctx := context.WithValue(context.Background(), activityEnvContextKey, &activityEnvironment{
+		scheduleToCloseDeadline: time.Now().Add(-time.Minute),
+	})
+	require.Zero(t, RemainingBudget(ctx))
+}
+
+func TestRemainingBudget_ReflectsTimeRemaining(t *testing.T) {
+	ctx := context.WithValue(context.Background(), activityEnvContextKey, &activityEnvironment{
+		scheduleToCloseDeadline: time.Now().Add(time.Hour),
+	})
+	remaining := RemainingBudget(ctx)
+	require.Greater(t, remaining, 55*time.Minute)
+	require.LessOrEqual(t, remaining, time.Hour)
+}
+
+func TestGetInfoFromActivityEnv_ScheduleToCloseDeadline(t *testing.T) {
+	deadline := time.Now().Add(time.Hour)
+	ctx := context.WithValue(context.Background(), activityEnvContextKey, &activityEnvironment{
+		scheduleToCloseDeadline: deadline,
+	})
+	info := getInfoFromActivityEnv(ctx)
+	require.Equal(t, deadline, info.ScheduleToCloseDeadline)
+}
+
+// TestWithActivityTask_ScheduleToCloseDeadlineFixedAcrossRetriesWithClockSkew builds two attempts of the same
+// activity through WithActivityTask, as a retry after a failure would see, with the second attempt's
+// StartedTime pushed later than a naive Deadline-only model would expect (e.g. due to clock skew between the
+// server and worker, or time the task spent sitting in a queue). ScheduleToCloseDeadline is derived from
+// ScheduledTime, which the server keeps fixed across retries, so it must be identical on both attempts even
+// though the per-attempt Deadline moves with StartedTime.
+func TestWithActivityTask_ScheduleToCloseDeadlineFixedAcrossRetriesWithClockSkew(t *testing.T) {
+	scheduled := time.Now()
+	workflowExecution := &commonpb.WorkflowExecution{WorkflowId: "wf", RunId: "run"}
+	invoker := &recordingServiceInvoker{}
+
+	newTask := func(started time.Time, attempt int32) *workflowservice.PollActivityTaskQueueResponse {
+		return &workflowservice.PollActivityTaskQueueResponse{
+			ScheduledTime:          timestamppb.New(scheduled),
+			StartedTime:            timestamppb.New(started),
+			ScheduleToCloseTimeout: durationpb.New(time.Hour),
+			StartToCloseTimeout:    durationpb.New(10 * time.Minute),
+			Attempt:                attempt,
+			WorkflowExecution:      workflowExecution,
+		}
+	}
+
+	ctx1 := WithActivityTask(context.Background(), newTask(scheduled, 1), "tq", invoker, log.NewDefaultLogger(),
+		nil, nil, nil, nil, nil, false, 0)
+	defer GetAutoHeartbeatStopFunc(ctx1)()
+	info1 := GetActivityInfo(ctx1)
+
+	// Second attempt dispatched 20 minutes after the first, as if clock skew or queueing delay pushed its
+	// StartedTime later; still well within the 1-hour ScheduleToCloseTimeout.
+	ctx2 := WithActivityTask(context.Background(), newTask(scheduled.Add(20*time.Minute), 2), "tq", invoker,
+		log.NewDefaultLogger(), nil, nil, nil, nil, nil, false, 0)
+	defer GetAutoHeartbeatStopFunc(ctx2)()
+	info2 := GetActivityInfo(ctx2)
+
+	require.Equal(t, info1.ScheduleToCloseDeadline, info2.ScheduleToCloseDeadline,
+		"ScheduleToCloseDeadline is derived from ScheduledTime, fixed across retries, so it must not move between attempts")
+	require.NotEqual(t, info1.Deadline, info2.Deadline,
+		"Deadline is derived from this attempt's StartedTime, so it must move between attempts")
+}
@@ -0,0 +1,266 @@
+// The MIT License
+//
+// Copyright (c) 2020 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package internal
+
+import (
+	"context"
+
+	"github.com/uber-go/tally"
+
+	"go.temporal.io/sdk/log"
+)
+
+type (
+	// ExecuteActivityInput is the input to ActivityInboundInterceptor.ExecuteActivity.
+	ExecuteActivityInput struct {
+		Args []interface{}
+	}
+
+	// ActivityInboundInterceptor is implemented by any code wanting to intercept an activity invocation, analogous
+	// to WorkflowInboundInterceptor on the workflow side. Use ActivityInterceptorFactory to install one.
+	ActivityInboundInterceptor interface {
+		// Init is called once before ExecuteActivity is invoked, and hands the interceptor the outbound
+		// interceptor it should delegate to (directly, or via ActivityOutboundInterceptorBase) for calls such
+		// as RecordActivityHeartbeat and GetActivityInfo made from within the activity.
+		Init(outbound ActivityOutboundInterceptor) error
+
+		// ExecuteActivity is called when the activity is about to be invoked. Implementations should call
+		// the next interceptor in the chain to actually run the activity.
+		ExecuteActivity(ctx context.Context, in *ExecuteActivityInput) (interface{}, error)
+
+		// HandleHeartbeat is called once, before ExecuteActivity, if the task carried heartbeat details left over
+		// from a prior, failed attempt (i.e. HasHeartbeatDetails(ctx) would report true). Implementations that
+		// don't care about this can leave it to ActivityInboundInterceptorBase's no-op forwarding.
+		HandleHeartbeat(details ...interface{})
+	}
+
+	// ActivityOutboundInterceptor is implemented by any code wanting to intercept calls to Temporal APIs made
+	// from within an activity.
+	ActivityOutboundInterceptor interface {
+		// GetInfo intercepts GetActivityInfo.
+		GetInfo(ctx context.Context) ActivityInfo
+		// GetLogger intercepts GetActivityLogger.
+		GetLogger(ctx context.Context) log.Logger
+		// GetMetricsScope intercepts GetActivityMetricsScope.
+		GetMetricsScope(ctx context.Context) tally.Scope
+		// RecordHeartbeat intercepts RecordActivityHeartbeat.
+		RecordHeartbeat(ctx context.Context, details ...interface{})
+		// RecordHeartbeatNow intercepts RecordHeartbeatNow.
+		RecordHeartbeatNow(ctx context.Context, details ...interface{})
+		// HasHeartbeatDetails intercepts HasHeartbeatDetails.
+		HasHeartbeatDetails(ctx context.Context) bool
+	}
+
+	// ActivityInterceptorFactory creates an ActivityInboundInterceptor chained in front of next for a single
+	// activity invocation. Register factories via WorkerOptions.ActivityInterceptors; they are applied in order,
+	// with the first factory's interceptor invoked first.
+	ActivityInterceptorFactory interface {
+		NewInterceptor(info ActivityInfo, next ActivityInboundInterceptor) ActivityInboundInterceptor
+	}
+)
+
+// ActivityInboundInterceptorBase is a noop implementation of ActivityInboundInterceptor meant for embedding: only
+// the methods relevant to a given interceptor need to be overridden.
+type ActivityInboundInterceptorBase struct {
+	Next ActivityInboundInterceptor
+}
+
+// Init forwards to the next interceptor in the chain.
+func (i *ActivityInboundInterceptorBase) Init(outbound ActivityOutboundInterceptor) error {
+	return i.Next.Init(outbound)
+}
+
+// ExecuteActivity forwards to the next interceptor in the chain.
+func (i *ActivityInboundInterceptorBase) ExecuteActivity(ctx context.Context, in *ExecuteActivityInput) (interface{}, error) {
+	return i.Next.ExecuteActivity(ctx, in)
+}
+
+// HandleHeartbeat forwards to the next interceptor in the chain.
+func (i *ActivityInboundInterceptorBase) HandleHeartbeat(details ...interface{}) {
+	i.Next.HandleHeartbeat(details...)
+}
+
+// ActivityOutboundInterceptorBase is a noop implementation of ActivityOutboundInterceptor meant for embedding: only
+// the methods relevant to a given interceptor need to be overridden.
+type ActivityOutboundInterceptorBase struct {
+	Next ActivityOutboundInterceptor
+}
+
+// GetInfo forwards to the next interceptor in the chain.
+func (i *ActivityOutboundInterceptorBase) GetInfo(ctx context.Context) ActivityInfo {
+	return i.Next.GetInfo(ctx)
+}
+
+// GetLogger forwards to the next interceptor in the chain.
+func (i *ActivityOutboundInterceptorBase) GetLogger(ctx context.Context) log.Logger {
+	return i.Next.GetLogger(ctx)
+}
+
+// GetMetricsScope forwards to the next interceptor in the chain.
+func (i *ActivityOutboundInterceptorBase) GetMetricsScope(ctx context.Context) tally.Scope {
+	return i.Next.GetMetricsScope(ctx)
+}
+
+// RecordHeartbeat forwards to the next interceptor in the chain.
+func (i *ActivityOutboundInterceptorBase) RecordHeartbeat(ctx context.Context, details ...interface{}) {
+	i.Next.RecordHeartbeat(ctx, details...)
+}
+
+// RecordHeartbeatNow forwards to the next interceptor in the chain.
+func (i *ActivityOutboundInterceptorBase) RecordHeartbeatNow(ctx context.Context, details ...interface{}) {
+	i.Next.RecordHeartbeatNow(ctx, details...)
+}
+
+// HasHeartbeatDetails forwards to the next interceptor in the chain.
+func (i *ActivityOutboundInterceptorBase) HasHeartbeatDetails(ctx context.Context) bool {
+	return i.Next.HasHeartbeatDetails(ctx)
+}
+
+// rootActivityOutboundInterceptor is the innermost outbound interceptor: it implements the APIs directly against
+// the activity environment rather than delegating further.
+type rootActivityOutboundInterceptor struct{}
+
+func (rootActivityOutboundInterceptor) GetInfo(ctx context.Context) ActivityInfo {
+	return getInfoFromActivityEnv(ctx)
+}
+
+func (rootActivityOutboundInterceptor) GetLogger(ctx context.Context) log.Logger {
+	return getActivityEnv(ctx).logger
+}
+
+func (rootActivityOutboundInterceptor) GetMetricsScope(ctx context.Context) tally.Scope {
+	return getActivityEnv(ctx).metricsScope
+}
+
+func (rootActivityOutboundInterceptor) RecordHeartbeat(ctx context.Context, details ...interface{}) {
+	recordActivityHeartbeat(ctx, details...)
+}
+
+func (rootActivityOutboundInterceptor) RecordHeartbeatNow(ctx context.Context, details ...interface{}) {
+	recordActivityHeartbeatImpl(ctx, true, details...)
+}
+
+func (rootActivityOutboundInterceptor) HasHeartbeatDetails(ctx context.Context) bool {
+	return getActivityEnv(ctx).heartbeatDetails != nil
+}
+
+// ActivityExecutor is the function that actually performs the work of an activity invocation. The worker builds
+// one as a thin adapter around the user's registered activity function; it is wired in as the innermost link of
+// the inbound interceptor chain by ExecuteActivityWithInterceptors.
+type ActivityExecutor func(ctx context.Context, in *ExecuteActivityInput) (interface{}, error)
+
+// activityExecutorInboundInterceptor is the innermost inbound interceptor: rather than forwarding further, it
+// invokes the ActivityExecutor it was built with. It also captures whatever outbound interceptor reaches it via
+// Init, possibly wrapped by interceptors earlier in the chain, so ExecuteActivityWithInterceptors can install it
+// into ctx before running the activity.
+type activityExecutorInboundInterceptor struct {
+	execute  ActivityExecutor
+	outbound ActivityOutboundInterceptor
+}
+
+func (e *activityExecutorInboundInterceptor) Init(outbound ActivityOutboundInterceptor) error {
+	e.outbound = outbound
+	return nil
+}
+
+func (e *activityExecutorInboundInterceptor) ExecuteActivity(ctx context.Context, in *ExecuteActivityInput) (interface{}, error) {
+	return e.execute(ctx, in)
+}
+
+func (e *activityExecutorInboundInterceptor) HandleHeartbeat(details ...interface{}) {
+}
+
+// ExecuteActivityWithInterceptors is the one entry point that actually wraps "auth, metrics, tracing,
+// retry-attempt annotations" (or any other cross-cutting concern) around a real activity invocation: it builds the
+// registered ActivityInterceptorFactory chain (outermost first) in front of execute, runs Init down the chain to
+// resolve the effective outbound interceptor (installing it into ctx so GetActivityInfo/RecordActivityHeartbeat/etc
+// called from inside the activity route through it too), invokes HandleHeartbeat if the task carried heartbeat
+// details from a failed prior attempt, and finally calls ExecuteActivity to run the activity itself.
+//
+// Callers should use this instead of invoking an activity function directly whenever WorkerOptions.ActivityInterceptors
+// might be configured.
+func ExecuteActivityWithInterceptors(
+	ctx context.Context,
+	factories []ActivityInterceptorFactory,
+	execute ActivityExecutor,
+	in *ExecuteActivityInput,
+) (interface{}, error) {
+	env := getActivityEnv(ctx)
+	info := getInfoFromActivityEnv(ctx)
+
+	executor := &activityExecutorInboundInterceptor{execute: execute}
+	var chain ActivityInboundInterceptor = executor
+	for i := len(factories) - 1; i >= 0; i-- {
+		chain = factories[i].NewInterceptor(info, chain)
+	}
+
+	if err := chain.Init(activityOutboundInterceptorFromContext(ctx)); err != nil {
+		return nil, err
+	}
+	// executor.outbound is whatever outbound interceptor reached the end of the chain: either the one already on
+	// ctx, unchanged, or a version wrapped by interceptors earlier in the chain overriding Init. Install it so
+	// GetActivityInfo, RecordActivityHeartbeat, etc. called from inside the activity route through it too.
+	ctx = WithActivityOutboundInterceptor(ctx, executor.outbound)
+
+	if env.heartbeatDetails != nil {
+		// HandleHeartbeat is a notification, not a decode request: the interceptor doesn't know in advance how
+		// many values or of what types the activity encoded, so (like HasHeartbeatDetails) it's only told that
+		// details exist. An interceptor that needs the values themselves can call GetHeartbeatDetails(ctx, ...)
+		// with its own expected argument types.
+		chain.HandleHeartbeat()
+	}
+
+	if env.tracer != nil {
+		// env.header carries whatever span context the workflow side injected, so this span continues that
+		// trace across the workflow->activity boundary rather than starting a new one.
+		var span TracerSpan
+		ctx, span = env.tracer.StartSpan(ctx, "RunActivity:"+info.ActivityType.Name, env.header)
+		defer span.Finish()
+	}
+
+	return chain.ExecuteActivity(ctx, in)
+}
+
+type activityOutboundInterceptorContextKeyType struct{}
+
+// activityOutboundInterceptorContextKey is the context key under which the head of the activity outbound
+// interceptor chain is stored by WithActivityOutboundInterceptor.
+var activityOutboundInterceptorContextKey = activityOutboundInterceptorContextKeyType{}
+
+// WithActivityOutboundInterceptor installs outbound as the head of the outbound interceptor chain visible to
+// GetActivityInfo, GetActivityLogger, GetActivityMetricsScope, RecordActivityHeartbeat, and HasHeartbeatDetails
+// called with ctx or any context derived from it.
+func WithActivityOutboundInterceptor(ctx context.Context, outbound ActivityOutboundInterceptor) context.Context {
+	return context.WithValue(ctx, activityOutboundInterceptorContextKey, outbound)
+}
+
+// activityOutboundInterceptorFromContext returns the installed outbound interceptor chain, defaulting to the root
+// interceptor when none was installed (e.g. in unit tests that build a context with WithActivityTask directly).
+func activityOutboundInterceptorFromContext(ctx context.Context) ActivityOutboundInterceptor {
+	if outbound, ok := ctx.Value(activityOutboundInterceptorContextKey).(ActivityOutboundInterceptor); ok {
+		return outbound
+	}
+	return rootActivityOutboundInterceptor{}
+}
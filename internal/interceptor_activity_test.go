@@ -0,0 +1,334 @@
+// The MIT License
+//
+// Copyright (c) 2020 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package internal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+
+	commonpb "go.temporal.io/api/common/v1"
+)
+
+// recordingInterceptor wraps every hook with a record of whether it ran, so tests can assert on
+// ordering relative to the wrapped activity invocation.
+type recordingInterceptor struct {
+	ActivityInboundInterceptorBase
+	name   string
+	trace  *[]string
+	hbSeen bool
+}
+
+func (i *recordingInterceptor) Init(outbound ActivityOutboundInterceptor) error {
+	*i.trace = append(*i.trace, i.name+":Init")
+	return i.ActivityInboundInterceptorBase.Init(outbound)
+}
+
+func (i *recordingInterceptor) ExecuteActivity(ctx context.Context, in *ExecuteActivityInput) (interface{}, error) {
+	*i.trace = append(*i.trace, i.name+":ExecuteActivity:before")
+	result, err := i.ActivityInboundInterceptorBase.ExecuteActivity(ctx, in)
+	*i.trace = append(*i.trace, i.name+":ExecuteActivity:after")
+	return result, err
+}
+
+func (i *recordingInterceptor) HandleHeartbeat(details ...interface{}) {
+	i.hbSeen = true
+	*i.trace = append(*i.trace, i.name+":HandleHeartbeat")
+	i.ActivityInboundInterceptorBase.HandleHeartbeat(details...)
+}
+
+type recordingInterceptorFactory struct {
+	name  string
+	trace *[]string
+}
+
+func (f *recordingInterceptorFactory) NewInterceptor(info ActivityInfo, next ActivityInboundInterceptor) ActivityInboundInterceptor {
+	return &recordingInterceptor{
+		ActivityInboundInterceptorBase: ActivityInboundInterceptorBase{Next: next},
+		name:                           f.name,
+		trace:                          f.trace,
+	}
+}
+
+func TestExecuteActivityWithInterceptors_RunsChainAndActivity(t *testing.T) {
+	var trace []string
+	ctx := context.WithValue(context.Background(), activityEnvContextKey, &activityEnvironment{})
+
+	factories := []ActivityInterceptorFactory{
+		&recordingInterceptorFactory{name: "outer", trace: &trace},
+		&recordingInterceptorFactory{name: "inner", trace: &trace},
+	}
+
+	ran := false
+	execute := func(ctx context.Context, in *ExecuteActivityInput) (interface{}, error) {
+		ran = true
+		return "result", nil
+	}
+
+	result, err := ExecuteActivityWithInterceptors(ctx, factories, execute, &ExecuteActivityInput{})
+	require.NoError(t, err)
+	require.Equal(t, "result", result)
+	require.True(t, ran, "ExecuteActivity must actually invoke the activity, not just resolve the chain")
+
+	require.Equal(t, []string{
+		"outer:Init",
+		"inner:Init",
+		"outer:ExecuteActivity:before",
+		"inner:ExecuteActivity:before",
+		"inner:ExecuteActivity:after",
+		"outer:ExecuteActivity:after",
+	}, trace, "outer factory must wrap inner, both must run around the real activity invocation")
+}
+
+func TestExecuteActivityWithInterceptors_HandleHeartbeatCalledWhenDetailsPresent(t *testing.T) {
+	var trace []string
+	ctx := context.WithValue(context.Background(), activityEnvContextKey, &activityEnvironment{
+		heartbeatDetails: &commonpb.Payloads{},
+	})
+	interceptor := &recordingInterceptor{name: "hb", trace: &trace}
+	factories := []ActivityInterceptorFactory{
+		&funcInterceptorFactory{new: func(info ActivityInfo, next ActivityInboundInterceptor) ActivityInboundInterceptor {
+			interceptor.ActivityInboundInterceptorBase = ActivityInboundInterceptorBase{Next: next}
+			return interceptor
+		}},
+	}
+
+	_, err := ExecuteActivityWithInterceptors(ctx, factories, func(ctx context.Context, in *ExecuteActivityInput) (interface{}, error) {
+		return nil, nil
+	}, &ExecuteActivityInput{})
+	require.NoError(t, err)
+	require.True(t, interceptor.hbSeen, "HandleHeartbeat should be invoked when the task carried heartbeat details")
+}
+
+func TestExecuteActivityWithInterceptors_NoInterceptorsStillRunsActivity(t *testing.T) {
+	ctx := context.WithValue(context.Background(), activityEnvContextKey, &activityEnvironment{})
+	ran := false
+	_, err := ExecuteActivityWithInterceptors(ctx, nil, func(ctx context.Context, in *ExecuteActivityInput) (interface{}, error) {
+		ran = true
+		return nil, nil
+	}, &ExecuteActivityInput{})
+	require.NoError(t, err)
+	require.True(t, ran)
+}
+
+type funcInterceptorFactory struct {
+	new func(info ActivityInfo, next ActivityInboundInterceptor) ActivityInboundInterceptor
+}
+
+func (f *funcInterceptorFactory) NewInterceptor(info ActivityInfo, next ActivityInboundInterceptor) ActivityInboundInterceptor {
+	return f.new(info, next)
+}
+
+func TestActivityOutboundInterceptorFromContext_DefaultsToRoot(t *testing.T) {
+	ctx := context.Background()
+	_, ok := activityOutboundInterceptorFromContext(ctx).(rootActivityOutboundInterceptor)
+	require.True(t, ok, "an unconfigured context should fall back to the root outbound interceptor")
+}
+
+// fakeTracerSpan records whether Finish was called.
+type fakeTracerSpan struct {
+	finished *bool
+}
+
+func (s *fakeTracerSpan) Finish() { *s.finished = true }
+
+// fakeTracer stands in for NewOpenTracingTracer/NewOpenTelemetryTracer so ExecuteActivityWithInterceptors'
+// use of activityEnvironment.tracer can be tested without a real tracing backend.
+type fakeTracer struct {
+	startedOperation string
+	startedHeader    *commonpb.Header
+	finished         bool
+}
+
+func (tr *fakeTracer) StartSpan(ctx context.Context, operationName string, header *commonpb.Header) (context.Context, TracerSpan) {
+	tr.startedOperation = operationName
+	tr.startedHeader = header
+	return ctx, &fakeTracerSpan{finished: &tr.finished}
+}
+
+func (tr *fakeTracer) Inject(ctx context.Context, header *commonpb.Header) error { return nil }
+
+func TestExecuteActivityWithInterceptors_StartsAndFinishesSpanWhenTracerConfigured(t *testing.T) {
+	tracer := &fakeTracer{}
+	header := &commonpb.Header{}
+	ctx := context.WithValue(context.Background(), activityEnvContextKey, &activityEnvironment{
+		activityType: ActivityType{Name: "MyActivity"},
+		tracer:       tracer,
+		header:       header,
+	})
+
+	_, err := ExecuteActivityWithInterceptors(ctx, nil, func(ctx context.Context, in *ExecuteActivityInput) (interface{}, error) {
+		return nil, nil
+	}, &ExecuteActivityInput{})
+	require.NoError(t, err)
+
+	require.Equal(t, "RunActivity:MyActivity", tracer.startedOperation,
+		"the activity's WorkerOptions.Tracer must actually be consulted, using the task's Header to continue the workflow->activity trace")
+	require.Same(t, header, tracer.startedHeader)
+	require.True(t, tracer.finished, "the span must be finished once the activity invocation returns")
+}
+
+func TestExecuteActivityWithInterceptors_NoTracerConfiguredSkipsSpan(t *testing.T) {
+	ctx := context.WithValue(context.Background(), activityEnvContextKey, &activityEnvironment{})
+	ran := false
+	_, err := ExecuteActivityWithInterceptors(ctx, nil, func(ctx context.Context, in *ExecuteActivityInput) (interface{}, error) {
+		ran = true
+		return nil, nil
+	}, &ExecuteActivityInput{})
+	require.NoError(t, err)
+	require.True(t, ran)
+}
+
+// countingOutboundInterceptor is a terminal outbound interceptor (no Next) used to observe how many
+// RecordHeartbeat calls actually reach the bottom of the chain, isolated from recordActivityHeartbeatImpl's
+// ServiceInvoker/DataConverter plumbing.
+type countingOutboundInterceptor struct {
+	ActivityOutboundInterceptorBase
+	calls int
+}
+
+func (i *countingOutboundInterceptor) RecordHeartbeat(ctx context.Context, details ...interface{}) {
+	i.calls++
+}
+
+// heartbeatThrottlingOutboundInterceptor demonstrates a practical use of the outbound interceptor chain: capping
+// how often RecordActivityHeartbeat actually reaches the service, independent of and in addition to
+// ServiceInvoker/WorkerOptions.Default/MaxHeartbeatThrottleInterval batching.
+type heartbeatThrottlingOutboundInterceptor struct {
+	ActivityOutboundInterceptorBase
+	interval time.Duration
+	now      func() time.Time
+	last     time.Time
+}
+
+func (i *heartbeatThrottlingOutboundInterceptor) RecordHeartbeat(ctx context.Context, details ...interface{}) {
+	now := i.now()
+	if !i.last.IsZero() && now.Sub(i.last) < i.interval {
+		return
+	}
+	i.last = now
+	i.ActivityOutboundInterceptorBase.RecordHeartbeat(ctx, details...)
+}
+
+type heartbeatThrottlingInboundInterceptor struct {
+	ActivityInboundInterceptorBase
+	outbound *heartbeatThrottlingOutboundInterceptor
+}
+
+func (i *heartbeatThrottlingInboundInterceptor) Init(outbound ActivityOutboundInterceptor) error {
+	i.outbound.Next = outbound
+	return i.ActivityInboundInterceptorBase.Init(i.outbound)
+}
+
+func TestHeartbeatThrottlingInterceptor_DropsHeartbeatsWithinInterval(t *testing.T) {
+	terminal := &countingOutboundInterceptor{}
+	clock := time.Now()
+	throttle := &heartbeatThrottlingOutboundInterceptor{
+		interval: time.Minute,
+		now:      func() time.Time { return clock },
+	}
+	factories := []ActivityInterceptorFactory{
+		&funcInterceptorFactory{new: func(info ActivityInfo, next ActivityInboundInterceptor) ActivityInboundInterceptor {
+			return &heartbeatThrottlingInboundInterceptor{
+				ActivityInboundInterceptorBase: ActivityInboundInterceptorBase{Next: next},
+				outbound:                       throttle,
+			}
+		}},
+	}
+
+	ctx := context.WithValue(context.Background(), activityEnvContextKey, &activityEnvironment{})
+	ctx = WithActivityOutboundInterceptor(ctx, terminal)
+
+	_, err := ExecuteActivityWithInterceptors(ctx, factories, func(ctx context.Context, in *ExecuteActivityInput) (interface{}, error) {
+		outbound := activityOutboundInterceptorFromContext(ctx)
+		outbound.RecordHeartbeat(ctx, "first")  // forwarded: nothing heartbeated yet
+		outbound.RecordHeartbeat(ctx, "second") // dropped: still within interval
+		clock = clock.Add(2 * time.Minute)
+		outbound.RecordHeartbeat(ctx, "third") // forwarded: interval elapsed
+		return nil, nil
+	}, &ExecuteActivityInput{})
+	require.NoError(t, err)
+
+	require.Equal(t, 2, terminal.calls, "only heartbeats outside the throttle interval should reach the terminal interceptor")
+}
+
+// metricsTaggingOutboundInterceptor demonstrates the other use case called out for the outbound interceptor
+// chain: tagging every tally.Scope an activity's code gets back from GetActivityMetricsScope with the activity
+// type, so individual activities don't need to do it themselves.
+type metricsTaggingOutboundInterceptor struct {
+	ActivityOutboundInterceptorBase
+	activityType string
+}
+
+func (i *metricsTaggingOutboundInterceptor) GetMetricsScope(ctx context.Context) tally.Scope {
+	return i.ActivityOutboundInterceptorBase.GetMetricsScope(ctx).Tagged(map[string]string{"activity_type": i.activityType})
+}
+
+type metricsTaggingInboundInterceptor struct {
+	ActivityInboundInterceptorBase
+	activityType string
+}
+
+func (i *metricsTaggingInboundInterceptor) Init(outbound ActivityOutboundInterceptor) error {
+	return i.ActivityInboundInterceptorBase.Init(&metricsTaggingOutboundInterceptor{
+		ActivityOutboundInterceptorBase: ActivityOutboundInterceptorBase{Next: outbound},
+		activityType:                    i.activityType,
+	})
+}
+
+func TestMetricsTaggingInterceptor_TagsMetricsScopeWithActivityType(t *testing.T) {
+	scope := tally.NewTestScope("", nil)
+	ctx := context.WithValue(context.Background(), activityEnvContextKey, &activityEnvironment{
+		activityType: ActivityType{Name: "MyActivity"},
+		metricsScope: scope,
+	})
+
+	factories := []ActivityInterceptorFactory{
+		&funcInterceptorFactory{new: func(info ActivityInfo, next ActivityInboundInterceptor) ActivityInboundInterceptor {
+			return &metricsTaggingInboundInterceptor{
+				ActivityInboundInterceptorBase: ActivityInboundInterceptorBase{Next: next},
+				activityType:                   info.ActivityType.Name,
+			}
+		}},
+	}
+
+	_, err := ExecuteActivityWithInterceptors(ctx, factories, func(ctx context.Context, in *ExecuteActivityInput) (interface{}, error) {
+		GetActivityMetricsScope(ctx).Counter("my_counter").Inc(1)
+		return nil, nil
+	}, &ExecuteActivityInput{})
+	require.NoError(t, err)
+
+	found := false
+	for _, c := range scope.Snapshot().Counters() {
+		if c.Tags()["activity_type"] == "MyActivity" {
+			found = true
+			require.EqualValues(t, 1, c.Value())
+		}
+	}
+	require.True(t, found, "metrics emitted from inside the activity should be tagged with the activity type by the interceptor")
+}
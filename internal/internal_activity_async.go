@@ -0,0 +1,90 @@
+// The MIT License
+//
+// Copyright (c) 2020 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package internal
+
+import (
+	"context"
+	"errors"
+)
+
+// CompletionHandle lets an activity be completed from somewhere other than
+// the goroutine that is executing it, including from another process. It is
+// obtained by calling DoAsync from within the activity, or reconstructed
+// from a raw task token via NewCompletionHandle.
+type CompletionHandle interface {
+	// Complete reports the activity as having completed successfully with result.
+	Complete(result interface{}) error
+	// Fail reports the activity as having failed with err.
+	Fail(err error) error
+	// Cancel reports the activity as canceled.
+	Cancel() error
+}
+
+type completionHandle struct {
+	taskToken []byte
+	client    Client
+}
+
+// NewCompletionHandle builds a CompletionHandle from a raw activity task
+// token, as found on ActivityInfo.TaskToken, and a Client connected to the
+// activity's namespace. Use this to complete an activity from a process
+// other than the one that started executing it: export the task token
+// alongside whatever work needs to happen out of process, then reconstruct
+// the handle once that work finishes.
+func NewCompletionHandle(taskToken []byte, client Client) CompletionHandle {
+	return &completionHandle{taskToken: taskToken, client: client}
+}
+
+func (h *completionHandle) Complete(result interface{}) error {
+	return h.client.CompleteActivity(context.Background(), h.taskToken, result, nil)
+}
+
+func (h *completionHandle) Fail(err error) error {
+	return h.client.CompleteActivity(context.Background(), h.taskToken, nil, err)
+}
+
+func (h *completionHandle) Cancel() error {
+	return h.client.CompleteActivity(context.Background(), h.taskToken, nil, NewCanceledError())
+}
+
+// DoAsync marks the currently executing activity as completing
+// asynchronously and returns a CompletionHandle for it. The activity
+// function must still return ErrActivityResultPending (directly, or wrapped)
+// so the worker knows not to treat its return value as the final result;
+// DoAsync only prepares the handle and, since nothing further will be
+// reported on this goroutine, stops the activity's auto-heartbeat loop if
+// RegisterActivityOptions.EnableAutoHeartbeat started one. DoAsync is not
+// supported for local activities, since they have no task token to hand off.
+func DoAsync(ctx context.Context) (CompletionHandle, error) {
+	env := getActivityEnv(ctx)
+	if env.isLocalActivity {
+		return nil, errors.New("activity: DoAsync is not supported for local activities")
+	}
+	if h, ok := ctx.Value(autoHeartbeatContextKey).(*autoHeartbeater); ok {
+		h.stop()
+	}
+	client := env.serviceInvoker.GetClient(ClientOptions{Namespace: env.workflowNamespace})
+	return NewCompletionHandle(env.taskToken, client), nil
+}
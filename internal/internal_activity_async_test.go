@@ -0,0 +1,117 @@
+// The MIT License
+//
+// Copyright (c) 2020 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package internal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeCompletionClient struct {
+	Client
+	taskToken []byte
+	result    interface{}
+	err       error
+	calls     int
+}
+
+func (c *fakeCompletionClient) CompleteActivity(ctx context.Context, taskToken []byte, result interface{}, err error) error {
+	c.calls++
+	c.taskToken = taskToken
+	c.result = result
+	c.err = err
+	return nil
+}
+
+func TestDoAsync_NotSupportedForLocalActivities(t *testing.T) {
+	ctx := context.WithValue(context.Background(), activityEnvContextKey, &activityEnvironment{
+		isLocalActivity: true,
+	})
+	_, err := DoAsync(ctx)
+	require.Error(t, err)
+}
+
+func TestDoAsync_StopsAutoHeartbeatAndReturnsHandle(t *testing.T) {
+	client := &fakeCompletionClient{}
+	invoker := &recordingServiceInvoker{client: client}
+	ctx := context.WithValue(context.Background(), activityEnvContextKey, &activityEnvironment{
+		taskToken:           []byte("token"),
+		serviceInvoker:      invoker,
+		heartbeatTimeout:    50 * time.Millisecond,
+		enableAutoHeartbeat: true,
+	})
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithCancel(ctx)
+	defer cancel()
+	ctx, stopAuto := WithAutoHeartbeat(ctx, cancel)
+	defer stopAuto()
+
+	h, ok := ctx.Value(autoHeartbeatContextKey).(*autoHeartbeater)
+	require.True(t, ok)
+
+	handle, err := DoAsync(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, handle)
+
+	select {
+	case <-h.doneCh:
+	default:
+		t.Fatal("DoAsync should have stopped the running auto-heartbeat loop")
+	}
+
+	// The handle DoAsync returned must be backed by the Client that the env's ServiceInvoker hands back from
+	// GetClient, so completing it from elsewhere actually reaches the service.
+	require.NoError(t, handle.Complete("done"))
+	require.Equal(t, 1, client.calls)
+	require.Equal(t, []byte("token"), client.taskToken)
+	require.Equal(t, "done", client.result)
+}
+
+func TestCompletionHandle_CompleteFailCancel(t *testing.T) {
+	client := &fakeCompletionClient{}
+	handle := NewCompletionHandle([]byte("task-token"), client)
+
+	require.NoError(t, handle.Complete("done"))
+	require.Equal(t, []byte("task-token"), client.taskToken)
+	require.Equal(t, "done", client.result)
+	require.NoError(t, client.err)
+
+	failErr := errTestFail
+	require.NoError(t, handle.Fail(failErr))
+	require.Equal(t, failErr, client.err)
+
+	require.NoError(t, handle.Cancel())
+	_, ok := client.err.(*CanceledError)
+	require.True(t, ok, "Cancel should complete the activity with a CanceledError")
+}
+
+var errTestFail = &testFailError{}
+
+type testFailError struct{}
+
+func (e *testFailError) Error() string { return "test failure" }
@@ -0,0 +1,152 @@
+// The MIT License
+//
+// Copyright (c) 2020 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package internal
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	commonpb "go.temporal.io/api/common/v1"
+)
+
+// autoHeartbeatIntervalFactor is the fraction of the negotiated
+// HeartbeatTimeout used as the interval between automatically emitted
+// heartbeats, leaving headroom for network latency before the server-side
+// heartbeat timeout fires.
+const autoHeartbeatIntervalFactor = 0.8
+
+type autoHeartbeatContextKeyType struct{}
+
+// autoHeartbeatContextKey is the context key under which the running
+// autoHeartbeater, if any, is stashed so RecordActivityHeartbeat can
+// coalesce with it.
+var autoHeartbeatContextKey = autoHeartbeatContextKeyType{}
+
+// autoHeartbeater drives a background heartbeat loop on behalf of an
+// activity registered with RegisterActivityOptions.EnableAutoHeartbeat. It
+// invokes ServiceInvoker.Heartbeat on a timer derived from HeartbeatTimeout
+// and cancels the supplied context if the server reports the activity as
+// canceled.
+type autoHeartbeater struct {
+	mu       sync.Mutex
+	invoker  ServiceInvoker
+	cancel   context.CancelFunc
+	interval time.Duration
+	details  *commonpb.Payloads
+	resetCh  chan struct{}
+	doneCh   chan struct{}
+	stopOnce sync.Once
+}
+
+type autoHeartbeatStopContextKeyType struct{}
+
+// autoHeartbeatStopContextKey is the context key under which the stop function for this activity's
+// autoHeartbeater, if any was started, is stashed so callers that invoke the activity function (and so know when
+// it returns) can retrieve it without needing WithActivityTask/WithLocalActivityTask to change their return type.
+var autoHeartbeatStopContextKey = autoHeartbeatStopContextKeyType{}
+
+// GetAutoHeartbeatStopFunc returns the function that must be called once the activity function returns, to stop the background auto-heartbeat loop started because RegisterActivityOptions.EnableAutoHeartbeat
+// was set. Returns a no-op if auto-heartbeat was never started for this activity, e.g. because the option wasn't
+// set or HeartbeatTimeout was zero.
+func GetAutoHeartbeatStopFunc(ctx context.Context) func() {
+	if stop, ok := ctx.Value(autoHeartbeatStopContextKey).(func()); ok {
+		return stop
+	}
+	return func() {}
+}
+
+// WithAutoHeartbeat starts a background heartbeat loop for an activity whose
+// RegisterActivityOptions.EnableAutoHeartbeat is set and whose
+// HeartbeatTimeout is non-zero. It returns a context carrying the running
+// heartbeater so RecordActivityHeartbeat can coalesce with it, along with a
+// stop function that must be called once the activity function returns.
+// WithAutoHeartbeat is a no-op for local activities and for activities that
+// didn't opt in via EnableAutoHeartbeat.
+func WithAutoHeartbeat(ctx context.Context, cancel context.CancelFunc) (context.Context, func()) {
+	env := getActivityEnv(ctx)
+	if env.isLocalActivity || !env.enableAutoHeartbeat || env.heartbeatTimeout <= 0 {
+		return ctx, func() {}
+	}
+	h := &autoHeartbeater{
+		invoker:  env.serviceInvoker,
+		cancel:   cancel,
+		interval: time.Duration(float64(env.heartbeatTimeout) * autoHeartbeatIntervalFactor),
+		resetCh:  make(chan struct{}, 1),
+		doneCh:   make(chan struct{}),
+	}
+	go h.run(ctx)
+	return context.WithValue(ctx, autoHeartbeatContextKey, h), h.stop
+}
+
+// recordAndReset is invoked by RecordActivityHeartbeat when the activity
+// code heartbeats manually. It caches the details so the next automatic
+// heartbeat reports them, and restarts the interval timer so the two don't
+// race each other.
+func (h *autoHeartbeater) recordAndReset(details *commonpb.Payloads) {
+	h.mu.Lock()
+	h.details = details
+	h.mu.Unlock()
+	select {
+	case h.resetCh <- struct{}{}:
+	default:
+	}
+}
+
+func (h *autoHeartbeater) run(ctx context.Context) {
+	timer := time.NewTimer(h.interval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-h.doneCh:
+			return
+		case <-ctx.Done():
+			return
+		case <-h.resetCh:
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(h.interval)
+		case <-timer.C:
+			h.mu.Lock()
+			details := h.details
+			h.mu.Unlock()
+			if err := h.invoker.Heartbeat(ctx, details, false); err != nil {
+				if _, ok := err.(*CanceledError); ok {
+					h.cancel()
+					return
+				}
+			}
+			timer.Reset(h.interval)
+		}
+	}
+}
+
+// stop terminates the background heartbeat loop. Safe to call concurrently and more than once.
+func (h *autoHeartbeater) stop() {
+	h.stopOnce.Do(func() {
+		close(h.doneCh)
+	})
+}
@@ -0,0 +1,213 @@
+// The MIT License
+//
+// Copyright (c) 2020 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package internal
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	commonpb "go.temporal.io/api/common/v1"
+	"go.temporal.io/api/workflowservice/v1"
+
+	"go.temporal.io/sdk/log"
+)
+
+type recordingServiceInvoker struct {
+	mu        sync.Mutex
+	calls     int
+	client    Client
+	heartbeat func(ctx context.Context, details *commonpb.Payloads, skipBatching bool) error
+}
+
+func (r *recordingServiceInvoker) Heartbeat(ctx context.Context, details *commonpb.Payloads, skipBatching bool) error {
+	r.mu.Lock()
+	r.calls++
+	hb := r.heartbeat
+	r.mu.Unlock()
+	if hb != nil {
+		return hb(ctx, details, skipBatching)
+	}
+	return nil
+}
+
+func (r *recordingServiceInvoker) Close(ctx context.Context, flushBufferedHeartbeat bool) {}
+
+func (r *recordingServiceInvoker) GetClient(options ClientOptions) Client { return r.client }
+
+func (r *recordingServiceInvoker) callCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.calls
+}
+
+func TestWithAutoHeartbeat_NotOptedIn(t *testing.T) {
+	ctx := context.WithValue(context.Background(), activityEnvContextKey, &activityEnvironment{
+		serviceInvoker:      &recordingServiceInvoker{},
+		heartbeatTimeout:    time.Second,
+		enableAutoHeartbeat: false,
+	})
+	_, cancel := context.WithCancel(ctx)
+	newCtx, stop := WithAutoHeartbeat(ctx, cancel)
+	defer stop()
+
+	require.Nil(t, newCtx.Value(autoHeartbeatContextKey), "auto-heartbeat must not start unless EnableAutoHeartbeat was set")
+}
+
+func TestWithAutoHeartbeat_NoHeartbeatTimeout(t *testing.T) {
+	ctx := context.WithValue(context.Background(), activityEnvContextKey, &activityEnvironment{
+		serviceInvoker:      &recordingServiceInvoker{},
+		heartbeatTimeout:    0,
+		enableAutoHeartbeat: true,
+	})
+	_, cancel := context.WithCancel(ctx)
+	newCtx, stop := WithAutoHeartbeat(ctx, cancel)
+	defer stop()
+
+	require.Nil(t, newCtx.Value(autoHeartbeatContextKey), "auto-heartbeat must not start with no HeartbeatTimeout")
+}
+
+func TestAutoHeartbeater_TimerResetOnManualHeartbeat(t *testing.T) {
+	invoker := &recordingServiceInvoker{}
+	ctx := context.WithValue(context.Background(), activityEnvContextKey, &activityEnvironment{
+		serviceInvoker:      invoker,
+		heartbeatTimeout:    50 * time.Millisecond,
+		enableAutoHeartbeat: true,
+	})
+	_, cancel := context.WithCancel(ctx)
+	ctx, stop := WithAutoHeartbeat(ctx, cancel)
+	defer stop()
+
+	h, ok := ctx.Value(autoHeartbeatContextKey).(*autoHeartbeater)
+	require.True(t, ok)
+
+	// Repeatedly "manually" heartbeat faster than the auto interval; the timer should keep being
+	// reset and no automatic heartbeat should fire in between.
+	for i := 0; i < 5; i++ {
+		h.recordAndReset(nil)
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.Zero(t, invoker.callCount(), "manual heartbeats should have kept resetting the automatic timer")
+
+	time.Sleep(100 * time.Millisecond)
+	require.GreaterOrEqual(t, invoker.callCount(), 1, "automatic heartbeat should eventually fire once manual heartbeats stop")
+}
+
+func TestWithActivityTask_WiresEnableAutoHeartbeatThrough(t *testing.T) {
+	invoker := &recordingServiceInvoker{}
+	task := &workflowservice.PollActivityTaskQueueResponse{
+		HeartbeatTimeout:  durationpb.New(50 * time.Millisecond),
+		WorkflowExecution: &commonpb.WorkflowExecution{WorkflowId: "wf", RunId: "run"},
+	}
+
+	ctx := WithActivityTask(context.Background(), task, "tq", invoker, log.NewDefaultLogger(), nil, nil, nil, nil, nil, true, 0)
+	defer GetAutoHeartbeatStopFunc(ctx)()
+
+	_, ok := ctx.Value(autoHeartbeatContextKey).(*autoHeartbeater)
+	require.True(t, ok, "WithActivityTask should start the auto-heartbeat loop when enableAutoHeartbeat is true and HeartbeatTimeout is set")
+}
+
+func TestWithActivityTask_EnableAutoHeartbeatOptOut(t *testing.T) {
+	invoker := &recordingServiceInvoker{}
+	task := &workflowservice.PollActivityTaskQueueResponse{
+		HeartbeatTimeout:  durationpb.New(50 * time.Millisecond),
+		WorkflowExecution: &commonpb.WorkflowExecution{WorkflowId: "wf", RunId: "run"},
+	}
+
+	ctx := WithActivityTask(context.Background(), task, "tq", invoker, log.NewDefaultLogger(), nil, nil, nil, nil, nil, false, 0)
+	defer GetAutoHeartbeatStopFunc(ctx)()
+
+	require.Nil(t, ctx.Value(autoHeartbeatContextKey), "WithActivityTask must not start the auto-heartbeat loop unless enableAutoHeartbeat is true")
+}
+
+func TestAutoHeartbeater_CanceledHeartbeatCancelsContext(t *testing.T) {
+	invoker := &recordingServiceInvoker{
+		heartbeat: func(ctx context.Context, details *commonpb.Payloads, skipBatching bool) error {
+			return NewCanceledError()
+		},
+	}
+	ctx := context.WithValue(context.Background(), activityEnvContextKey, &activityEnvironment{
+		serviceInvoker:      invoker,
+		heartbeatTimeout:    20 * time.Millisecond,
+		enableAutoHeartbeat: true,
+	})
+	ctx, cancel := context.WithCancel(ctx)
+	ctx, stop := WithAutoHeartbeat(ctx, cancel)
+	defer stop()
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("ctx should have been canceled once the automatic heartbeat got a CanceledError back")
+	}
+	require.ErrorIs(t, ctx.Err(), context.Canceled)
+}
+
+func TestAutoHeartbeater_ExitsWhenOuterContextCanceled(t *testing.T) {
+	// Simulates the worker-stop path: the outer context passed to WithAutoHeartbeat is canceled (e.g. because
+	// the worker is shutting down), independent of anything the ServiceInvoker reports. run()'s ctx.Done() case
+	// must end the loop so it stops heartbeating rather than continuing to fire on the old timer.
+	invoker := &recordingServiceInvoker{}
+	ctx := context.WithValue(context.Background(), activityEnvContextKey, &activityEnvironment{
+		serviceInvoker:      invoker,
+		heartbeatTimeout:    30 * time.Millisecond,
+		enableAutoHeartbeat: true,
+	})
+	ctx, cancel := context.WithCancel(ctx)
+	ctx, stop := WithAutoHeartbeat(ctx, cancel)
+	defer stop()
+
+	_, ok := ctx.Value(autoHeartbeatContextKey).(*autoHeartbeater)
+	require.True(t, ok)
+
+	cancel()
+	time.Sleep(100 * time.Millisecond) // long past the heartbeat interval, had the loop kept running
+
+	require.Zero(t, invoker.callCount(), "the heartbeat loop must stop once the outer (worker-stop) context is canceled")
+}
+
+func TestAutoHeartbeater_StopIsIdempotentAndConcurrencySafe(t *testing.T) {
+	h := &autoHeartbeater{doneCh: make(chan struct{})}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h.stop()
+		}()
+	}
+	wg.Wait()
+
+	select {
+	case <-h.doneCh:
+	default:
+		t.Fatal("expected doneCh to be closed after stop()")
+	}
+}
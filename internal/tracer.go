@@ -0,0 +1,52 @@
+// The MIT License
+//
+// Copyright (c) 2020 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package internal
+
+import (
+	"context"
+
+	commonpb "go.temporal.io/api/common/v1"
+)
+
+type (
+	// TracerSpan is a single span started by a Tracer. Call Finish when the traced operation completes.
+	TracerSpan interface {
+		Finish()
+	}
+
+	// Tracer is a minimal, tracing-implementation-neutral abstraction used by activityEnvironment instead of
+	// depending directly on either OpenTracing or OpenTelemetry. It lets the worker start and propagate spans
+	// across the workflow->activity boundary without committing the SDK to one tracing ecosystem. Construct one
+	// with NewOpenTracingTracer or NewOpenTelemetryTracer and pass it to WithActivityTask.
+	Tracer interface {
+		// StartSpan starts a new span named operationName, as a child of whatever span is encoded in header, if
+		// any, and returns ctx carrying the new span alongside the span itself.
+		StartSpan(ctx context.Context, operationName string, header *commonpb.Header) (context.Context, TracerSpan)
+
+		// Inject encodes the span active on ctx, if any, into header so a downstream caller's StartSpan can pick
+		// it up as the parent span.
+		Inject(ctx context.Context, header *commonpb.Header) error
+	}
+)
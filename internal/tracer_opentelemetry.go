@@ -0,0 +1,94 @@
+// The MIT License
+//
+// Copyright (c) 2020 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package internal
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/propagation"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	commonpb "go.temporal.io/api/common/v1"
+)
+
+type openTelemetryTracer struct {
+	tracer oteltrace.Tracer
+	prop   propagation.TextMapPropagator
+}
+
+// NewOpenTelemetryTracer adapts an OpenTelemetry trace.Tracer to the SDK's neutral Tracer interface, using prop to
+// inject/extract span context across the workflow->activity boundary. Pass propagation.TraceContext{} for prop if
+// the application doesn't otherwise configure one.
+func NewOpenTelemetryTracer(tracer oteltrace.Tracer, prop propagation.TextMapPropagator) Tracer {
+	return &openTelemetryTracer{tracer: tracer, prop: prop}
+}
+
+// openTelemetryHeaderCarrier adapts a *commonpb.Header to propagation.TextMapCarrier so span context can be
+// injected into and extracted from the same Header the SDK already uses for context propagation.
+type openTelemetryHeaderCarrier struct {
+	header *commonpb.Header
+}
+
+func (c openTelemetryHeaderCarrier) Get(key string) string {
+	return string(c.header.GetFields()[key].GetData())
+}
+
+func (c openTelemetryHeaderCarrier) Set(key, value string) {
+	if c.header.Fields == nil {
+		c.header.Fields = make(map[string]*commonpb.Payload)
+	}
+	c.header.Fields[key] = &commonpb.Payload{Data: []byte(value)}
+}
+
+func (c openTelemetryHeaderCarrier) Keys() []string {
+	fields := c.header.GetFields()
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func (t *openTelemetryTracer) StartSpan(ctx context.Context, operationName string, header *commonpb.Header) (context.Context, TracerSpan) {
+	ctx = t.prop.Extract(ctx, openTelemetryHeaderCarrier{header})
+	ctx, span := t.tracer.Start(ctx, operationName)
+	return ctx, openTelemetrySpan{span}
+}
+
+func (t *openTelemetryTracer) Inject(ctx context.Context, header *commonpb.Header) error {
+	if header.Fields == nil {
+		header.Fields = make(map[string]*commonpb.Payload)
+	}
+	t.prop.Inject(ctx, openTelemetryHeaderCarrier{header})
+	return nil
+}
+
+type openTelemetrySpan struct {
+	span oteltrace.Span
+}
+
+func (s openTelemetrySpan) Finish() {
+	s.span.End()
+}
@@ -0,0 +1,91 @@
+// The MIT License
+//
+// Copyright (c) 2020 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package internal
+
+import (
+	"context"
+
+	"github.com/opentracing/opentracing-go"
+	commonpb "go.temporal.io/api/common/v1"
+)
+
+type openTracingTracer struct {
+	tracer opentracing.Tracer
+}
+
+// NewOpenTracingTracer adapts an opentracing.Tracer to the SDK's neutral Tracer interface.
+func NewOpenTracingTracer(tracer opentracing.Tracer) Tracer {
+	return &openTracingTracer{tracer: tracer}
+}
+
+// openTracingHeaderCarrier adapts a *commonpb.Header to opentracing.TextMapReader/Writer so span context can be
+// injected into and extracted from the same Header the SDK already uses for context propagation.
+type openTracingHeaderCarrier struct {
+	header *commonpb.Header
+}
+
+func (c openTracingHeaderCarrier) ForeachKey(handler func(key, val string) error) error {
+	for k, v := range c.header.GetFields() {
+		if err := handler(k, string(v.GetData())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c openTracingHeaderCarrier) Set(key, val string) {
+	if c.header.Fields == nil {
+		c.header.Fields = make(map[string]*commonpb.Payload)
+	}
+	c.header.Fields[key] = &commonpb.Payload{Data: []byte(val)}
+}
+
+func (t *openTracingTracer) StartSpan(ctx context.Context, operationName string, header *commonpb.Header) (context.Context, TracerSpan) {
+	var opts []opentracing.StartSpanOption
+	if parent, err := t.tracer.Extract(opentracing.TextMap, openTracingHeaderCarrier{header}); err == nil {
+		opts = append(opts, opentracing.ChildOf(parent))
+	}
+	span := t.tracer.StartSpan(operationName, opts...)
+	return opentracing.ContextWithSpan(ctx, span), openTracingSpan{span}
+}
+
+func (t *openTracingTracer) Inject(ctx context.Context, header *commonpb.Header) error {
+	span := opentracing.SpanFromContext(ctx)
+	if span == nil {
+		return nil
+	}
+	if header.Fields == nil {
+		header.Fields = make(map[string]*commonpb.Payload)
+	}
+	return t.tracer.Inject(span.Context(), opentracing.TextMap, openTracingHeaderCarrier{header})
+}
+
+type openTracingSpan struct {
+	span opentracing.Span
+}
+
+func (s openTracingSpan) Finish() {
+	s.span.Finish()
+}
@@ -0,0 +1,94 @@
+// The MIT License
+//
+// Copyright (c) 2020 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package internal
+
+import (
+	"context"
+	"testing"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	commonpb "go.temporal.io/api/common/v1"
+)
+
+func TestOpenTracingTracer_InjectExtractRoundTrip(t *testing.T) {
+	mt := mocktracer.New()
+	tracer := NewOpenTracingTracer(mt)
+
+	parentCtx, parentSpan := tracer.StartSpan(context.Background(), "parent", &commonpb.Header{})
+	header := &commonpb.Header{}
+	require.NoError(t, tracer.Inject(parentCtx, header))
+	parentSpan.Finish()
+
+	require.NotEmpty(t, header.GetFields(), "Inject should have written span context into the header")
+
+	_, childSpan := tracer.StartSpan(context.Background(), "child", header)
+	childSpan.Finish()
+
+	spans := mt.FinishedSpans()
+	require.Len(t, spans, 2)
+	require.Equal(t, spans[0].SpanContext.SpanID, spans[1].ParentID,
+		"the child span started from the propagated header should be a child of the parent span")
+}
+
+func TestOpenTracingTracer_InjectWithNoActiveSpanIsNoop(t *testing.T) {
+	tracer := NewOpenTracingTracer(mocktracer.New())
+	header := &commonpb.Header{}
+	require.NoError(t, tracer.Inject(context.Background(), header))
+	require.Empty(t, header.GetFields())
+}
+
+func TestOpenTelemetryTracer_InjectExtractRoundTrip(t *testing.T) {
+	tp := sdktrace.NewTracerProvider()
+	defer tp.Shutdown(context.Background())
+	tracer := NewOpenTelemetryTracer(tp.Tracer("test"), propagation.TraceContext{})
+
+	parentCtx, parentSpan := tracer.StartSpan(context.Background(), "parent", &commonpb.Header{})
+	header := &commonpb.Header{}
+	require.NoError(t, tracer.Inject(parentCtx, header))
+	parentSpan.Finish()
+
+	require.NotEmpty(t, header.GetFields(), "Inject should have written traceparent into the header")
+
+	childCtx, childSpan := tracer.StartSpan(context.Background(), "child", header)
+	defer childSpan.Finish()
+
+	require.True(t, trace.SpanContextFromContext(childCtx).IsValid())
+}
+
+func TestWorkerOptions_TracerAcceptsEitherAdapter(t *testing.T) {
+	tp := sdktrace.NewTracerProvider()
+	defer tp.Shutdown(context.Background())
+
+	var opts WorkerOptions
+	opts = WorkerOptions{Tracer: NewOpenTracingTracer(mocktracer.New())}
+	require.NotNil(t, opts.Tracer)
+	opts = WorkerOptions{Tracer: NewOpenTelemetryTracer(tp.Tracer("test"), propagation.TraceContext{})}
+	require.NotNil(t, opts.Tracer)
+}
@@ -0,0 +1,52 @@
+// The MIT License
+//
+// Copyright (c) 2020 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package internal
+
+import "time"
+
+// WorkerOptions contains worker-level configuration consumed when starting a Worker.
+type WorkerOptions struct {
+	// ActivityInterceptors is applied to every activity this worker executes: factories are applied in order,
+	// with the first factory's interceptor invoked first (outermost), wrapping all the others. See
+	// ActivityInterceptorFactory and ExecuteActivityWithInterceptors.
+	// Optional: defaults to no interceptors.
+	ActivityInterceptors []ActivityInterceptorFactory
+
+	// DefaultHeartbeatThrottleInterval is the HeartbeatThrottleInterval used by an activity whose ActivityOptions
+	// didn't set one.
+	// Optional: defaults to 60 seconds.
+	DefaultHeartbeatThrottleInterval time.Duration
+
+	// MaxHeartbeatThrottleInterval caps the effective HeartbeatThrottleInterval of any activity on this worker,
+	// whatever ActivityOptions.HeartbeatThrottleInterval or DefaultHeartbeatThrottleInterval requested.
+	// Optional: defaults to 60 seconds.
+	MaxHeartbeatThrottleInterval time.Duration
+
+	// Tracer is used to start spans around activity execution and to propagate span context across the
+	// workflow->activity boundary via the task's Header. Accepts either NewOpenTracingTracer or
+	// NewOpenTelemetryTracer, or any other Tracer implementation.
+	// Optional: defaults to no tracing.
+	Tracer Tracer
+}